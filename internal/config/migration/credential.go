@@ -0,0 +1,146 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cli/cli/v2/internal/keyring"
+)
+
+// CredentialKind identifies the concrete type of secret carried by a
+// Credential so that envelopes can be round-tripped through the keyring
+// without losing their shape.
+type CredentialKind string
+
+const (
+	TokenCredentialKind         CredentialKind = "token"
+	LoginPasswordCredentialKind CredentialKind = "login_password"
+	SSHKeyCredentialKind        CredentialKind = "ssh_key"
+)
+
+// CredentialMeta is the information we want to retain about a credential
+// regardless of its kind, so that we can reason about it (e.g. to know
+// whether it's still fit for purpose) without touching the secret itself.
+type CredentialMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	Host      string    `json:"host"`
+	Login     string    `json:"login"`
+	Scopes    []string  `json:"scopes,omitempty"`
+}
+
+// Credential is anything that can be stored against a host/user pair in the
+// keyring. Concrete implementations hold the actual secret material.
+type Credential interface {
+	Kind() CredentialKind
+	Meta() CredentialMeta
+}
+
+// TokenCredential is an OAuth or personal access token, the only kind the
+// CLI has historically stored.
+type TokenCredential struct {
+	CredentialMeta
+	Token string `json:"token"`
+}
+
+func (c TokenCredential) Kind() CredentialKind { return TokenCredentialKind }
+func (c TokenCredential) Meta() CredentialMeta { return c.CredentialMeta }
+
+// LoginPasswordCredential is a classic username/password pair, e.g. for
+// GitHub Enterprise Server instances that haven't adopted OAuth device flow.
+type LoginPasswordCredential struct {
+	CredentialMeta
+	Password string `json:"password"`
+}
+
+func (c LoginPasswordCredential) Kind() CredentialKind { return LoginPasswordCredentialKind }
+func (c LoginPasswordCredential) Meta() CredentialMeta { return c.CredentialMeta }
+
+// SSHKeyCredential is a private key used to authenticate git operations
+// over SSH on behalf of a host/user pair.
+type SSHKeyCredential struct {
+	CredentialMeta
+	PrivateKey string `json:"private_key"`
+}
+
+func (c SSHKeyCredential) Kind() CredentialKind { return SSHKeyCredentialKind }
+func (c SSHKeyCredential) Meta() CredentialMeta { return c.CredentialMeta }
+
+// credentialEnvelope is the on-disk (well, on-keyring) shape of a
+// Credential. We keep the secret as a single opaque string and let each
+// kind decide how to pack/unpack its own fields into it.
+type credentialEnvelope struct {
+	Kind   CredentialKind `json:"kind"`
+	Meta   CredentialMeta `json:"meta"`
+	Secret string         `json:"secret"`
+}
+
+// CredentialStore persists Credentials to the OS keyring under a
+// per-user key, so that a single host can hold more than one account's
+// secret at a time.
+type CredentialStore struct{}
+
+// Store writes cred to the keyring under a key scoped to hostname and
+// username, overwriting whatever was there before.
+func (s CredentialStore) Store(hostname, username string, cred Credential) error {
+	envelope, err := encodeCredential(cred)
+	if err != nil {
+		return fmt.Errorf("couldn't encode credential: %w", err)
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal credential envelope: %w", err)
+	}
+
+	return keyring.Set(keyringServiceName(hostname), username, string(data))
+}
+
+// Lookup reads back whatever Credential was last stored for hostname and
+// username.
+func (s CredentialStore) Lookup(hostname, username string) (Credential, error) {
+	data, err := keyring.Get(keyringServiceName(hostname), username)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope credentialEnvelope
+	if err := json.Unmarshal([]byte(data), &envelope); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal credential envelope: %w", err)
+	}
+
+	return decodeCredential(envelope)
+}
+
+func encodeCredential(cred Credential) (credentialEnvelope, error) {
+	var secret string
+	switch c := cred.(type) {
+	case TokenCredential:
+		secret = c.Token
+	case LoginPasswordCredential:
+		secret = c.Password
+	case SSHKeyCredential:
+		secret = c.PrivateKey
+	default:
+		return credentialEnvelope{}, fmt.Errorf("unknown credential type %T", cred)
+	}
+
+	return credentialEnvelope{
+		Kind:   cred.Kind(),
+		Meta:   cred.Meta(),
+		Secret: secret,
+	}, nil
+}
+
+func decodeCredential(envelope credentialEnvelope) (Credential, error) {
+	switch envelope.Kind {
+	case TokenCredentialKind:
+		return TokenCredential{CredentialMeta: envelope.Meta, Token: envelope.Secret}, nil
+	case LoginPasswordCredentialKind:
+		return LoginPasswordCredential{CredentialMeta: envelope.Meta, Password: envelope.Secret}, nil
+	case SSHKeyCredentialKind:
+		return SSHKeyCredential{CredentialMeta: envelope.Meta, PrivateKey: envelope.Secret}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential kind %q", envelope.Kind)
+	}
+}
@@ -0,0 +1,93 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cli/cli/v2/internal/keyring"
+	"github.com/cli/go-gh/v2/pkg/config"
+)
+
+// CredentialEnvelopeUpgrade upgrades the per-user keyring entries written by
+// MultiAccount (which stored a bare oauth token string) into the structured
+// credential envelope that CredentialStore reads and writes. It is safe to
+// run more than once: entries that are already envelopes are left alone.
+type CredentialEnvelopeUpgrade struct {
+	// Allow injecting a transport layer in tests.
+	Transport http.RoundTripper
+}
+
+func (m CredentialEnvelopeUpgrade) PreVersion() string {
+	return "1"
+}
+
+func (m CredentialEnvelopeUpgrade) PostVersion() string {
+	return "2"
+}
+
+func (m CredentialEnvelopeUpgrade) Do(c *config.Config) error {
+	hostnames, err := c.Keys(hostsKey)
+	var keyNotFoundError *config.KeyNotFoundError
+	if errors.As(err, &keyNotFoundError) {
+		return nil
+	}
+	if err != nil {
+		return CowardlyRefusalError{errors.New("couldn't get hosts configuration")}
+	}
+
+	store := CredentialStore{}
+	for _, hostname := range hostnames {
+		usernames, err := c.Keys(append(hostsKey, hostname, "users"))
+		var keyNotFoundError *config.KeyNotFoundError
+		if errors.As(err, &keyNotFoundError) {
+			continue
+		}
+		if err != nil {
+			return CowardlyRefusalError{fmt.Errorf("couldn't get users configuration for %q: %w", hostname, err)}
+		}
+
+		for _, username := range usernames {
+			raw, err := keyring.Get(keyringServiceName(hostname), username)
+			if errors.Is(err, keyring.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return CowardlyRefusalError{fmt.Errorf("couldn't read keyring entry for %q: %w", hostname, err)}
+			}
+
+			if isCredentialEnvelope(raw) {
+				continue
+			}
+
+			// Best effort: a legacy token's scopes are worth recording if
+			// we can get them, but a scope check failing here shouldn't
+			// block the upgrade the way it blocks the original migration.
+			scopes, _ := checkTokenScopes(m.Transport, hostname, raw)
+
+			cred := TokenCredential{
+				CredentialMeta: CredentialMeta{
+					CreatedAt: time.Now(),
+					Host:      hostname,
+					Login:     username,
+					Scopes:    scopes,
+				},
+				Token: raw,
+			}
+			if err := store.Store(hostname, username, cred); err != nil {
+				return CowardlyRefusalError{fmt.Errorf("couldn't upgrade keyring entry for %q: %w", hostname, err)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// isCredentialEnvelope reports whether raw is already a JSON credential
+// envelope as opposed to a bare v1 token string.
+func isCredentialEnvelope(raw string) bool {
+	var envelope credentialEnvelope
+	return json.Unmarshal([]byte(raw), &envelope) == nil && envelope.Kind != ""
+}
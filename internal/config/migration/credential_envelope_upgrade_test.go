@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/cli/cli/v2/internal/keyring"
+	"github.com/cli/go-gh/v2/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialEnvelopeUpgrade_UpgradesLegacyToken(t *testing.T) {
+	keyring.MockInit()
+	require.NoError(t, keyring.Set(keyringServiceName("github.com"), "monalisa", "legacy-token"))
+
+	c := config.NewFromString(`
+hosts:
+  github.com:
+    user: monalisa
+    users:
+      monalisa:
+`)
+
+	m := CredentialEnvelopeUpgrade{
+		Transport: fakeScopesResponse(http.StatusOK, http.Header{
+			"X-Oauth-Scopes": []string{"repo, read:org, gist"},
+		}),
+	}
+	require.NoError(t, m.Do(c))
+
+	got, err := CredentialStore{}.Lookup("github.com", "monalisa")
+	require.NoError(t, err)
+
+	token, ok := got.(TokenCredential)
+	require.True(t, ok)
+	require.Equal(t, "legacy-token", token.Token)
+	require.Equal(t, []string{"repo", "read:org", "gist"}, token.Scopes)
+	require.Equal(t, "monalisa", token.Login)
+}
+
+func TestCredentialEnvelopeUpgrade_LeavesExistingEnvelopeAlone(t *testing.T) {
+	keyring.MockInit()
+
+	cred := TokenCredential{
+		CredentialMeta: CredentialMeta{Host: "github.com", Login: "monalisa", Scopes: []string{"repo"}},
+		Token:          "already-upgraded",
+	}
+	require.NoError(t, CredentialStore{}.Store("github.com", "monalisa", cred))
+	before, err := keyring.Get(keyringServiceName("github.com"), "monalisa")
+	require.NoError(t, err)
+
+	c := config.NewFromString(`
+hosts:
+  github.com:
+    user: monalisa
+    users:
+      monalisa:
+`)
+
+	m := CredentialEnvelopeUpgrade{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			t.Fatal("already-upgraded entries shouldn't trigger a scope check")
+			return nil, nil
+		}),
+	}
+	require.NoError(t, m.Do(c))
+
+	after, err := keyring.Get(keyringServiceName("github.com"), "monalisa")
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+
+	var envelope credentialEnvelope
+	require.NoError(t, json.Unmarshal([]byte(after), &envelope))
+	require.Equal(t, TokenCredentialKind, envelope.Kind)
+}
@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+)
+
+// credentialHelperVerb mirrors the verbs used by Docker's credential-helper
+// protocol (https://github.com/docker/docker-credential-helpers), which
+// gh-credential-<name> binaries are expected to implement.
+type credentialHelperVerb string
+
+const (
+	credentialHelperGet   credentialHelperVerb = "get"
+	credentialHelperStore credentialHelperVerb = "store"
+	credentialHelperErase credentialHelperVerb = "erase"
+	credentialHelperList  credentialHelperVerb = "list"
+)
+
+// credentialHelperEntry is the JSON shape exchanged with a helper binary on
+// stdin/stdout, matching docker-credential-helpers' Credentials struct.
+type credentialHelperEntry struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// credentialHelper shells out to a gh-credential-<name> binary on the PATH
+// so that auth secrets can be centralized in external tools such as `pass`,
+// secretservice, or a cloud secret manager, instead of the OS keyring.
+type credentialHelper struct {
+	name string
+	// exec is overridable in tests.
+	exec func(verb credentialHelperVerb, stdin []byte) ([]byte, error)
+}
+
+func newCredentialHelper(name string) *credentialHelper {
+	h := &credentialHelper{name: name}
+	h.exec = h.run
+	return h
+}
+
+// credentialHelperNameRegexp restricts a configured helper name to a safe
+// charset. h.name comes straight from the credential_helper entry in
+// hosts.yml, and is used to build the binary name exec.Command runs; a
+// name containing a "/" (e.g. "../../tmp/evil") would make exec.Command
+// skip the PATH lookup and run an arbitrary path instead.
+var credentialHelperNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (h *credentialHelper) run(verb credentialHelperVerb, stdin []byte) ([]byte, error) {
+	if !credentialHelperNameRegexp.MatchString(h.name) {
+		return nil, fmt.Errorf("invalid credential helper name %q", h.name)
+	}
+
+	cmd := exec.Command(fmt.Sprintf("gh-credential-%s", h.name), string(verb))
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gh-credential-%s %s: %w", h.name, verb, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Get returns the username/secret pair the helper has stored for serverURL.
+func (h *credentialHelper) Get(serverURL string) (username, secret string, err error) {
+	out, err := h.exec(credentialHelperGet, []byte(serverURL))
+	if err != nil {
+		return "", "", err
+	}
+	var entry credentialHelperEntry
+	if err := json.Unmarshal(out, &entry); err != nil {
+		return "", "", fmt.Errorf("couldn't parse gh-credential-%s output: %w", h.name, err)
+	}
+	return entry.Username, entry.Secret, nil
+}
+
+// Store writes username/secret for serverURL to the helper.
+func (h *credentialHelper) Store(serverURL, username, secret string) error {
+	in, err := json.Marshal(credentialHelperEntry{ServerURL: serverURL, Username: username, Secret: secret})
+	if err != nil {
+		return err
+	}
+	_, err = h.exec(credentialHelperStore, in)
+	return err
+}
+
+// Erase removes whatever the helper has stored for serverURL.
+func (h *credentialHelper) Erase(serverURL string) error {
+	_, err := h.exec(credentialHelperErase, []byte(serverURL))
+	return err
+}
+
+// List returns every serverURL the helper knows about, mapped to the
+// username stored against it.
+func (h *credentialHelper) List() (map[string]string, error) {
+	out, err := h.exec(credentialHelperList, nil)
+	if err != nil {
+		return nil, err
+	}
+	var list map[string]string
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("couldn't parse gh-credential-%s output: %w", h.name, err)
+	}
+	return list, nil
+}
+
+// credentialHelperKey is the hosts.yml entry that selects which helper, if
+// any, should be used for a given host in place of the OS keyring.
+var credentialHelperKey = "credential_helper"
@@ -0,0 +1,91 @@
+package migration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialHelper_Get(t *testing.T) {
+	h := newCredentialHelper("pass")
+	h.exec = func(verb credentialHelperVerb, stdin []byte) ([]byte, error) {
+		require.Equal(t, credentialHelperGet, verb)
+		require.Equal(t, "github.com", string(stdin))
+		return json.Marshal(credentialHelperEntry{ServerURL: "github.com", Username: "monalisa", Secret: "abc123"})
+	}
+
+	username, secret, err := h.Get("github.com")
+	require.NoError(t, err)
+	require.Equal(t, "monalisa", username)
+	require.Equal(t, "abc123", secret)
+}
+
+func TestCredentialHelper_GetMalformedOutput(t *testing.T) {
+	h := newCredentialHelper("pass")
+	h.exec = func(verb credentialHelperVerb, stdin []byte) ([]byte, error) {
+		return []byte("not json"), nil
+	}
+
+	_, _, err := h.Get("github.com")
+	require.Error(t, err)
+}
+
+func TestCredentialHelper_Store(t *testing.T) {
+	h := newCredentialHelper("pass")
+	var gotVerb credentialHelperVerb
+	var gotEntry credentialHelperEntry
+	h.exec = func(verb credentialHelperVerb, stdin []byte) ([]byte, error) {
+		gotVerb = verb
+		require.NoError(t, json.Unmarshal(stdin, &gotEntry))
+		return nil, nil
+	}
+
+	require.NoError(t, h.Store("github.com", "monalisa", "abc123"))
+	require.Equal(t, credentialHelperStore, gotVerb)
+	require.Equal(t, credentialHelperEntry{ServerURL: "github.com", Username: "monalisa", Secret: "abc123"}, gotEntry)
+}
+
+func TestCredentialHelper_Erase(t *testing.T) {
+	h := newCredentialHelper("pass")
+	var gotVerb credentialHelperVerb
+	var gotStdin string
+	h.exec = func(verb credentialHelperVerb, stdin []byte) ([]byte, error) {
+		gotVerb = verb
+		gotStdin = string(stdin)
+		return nil, nil
+	}
+
+	require.NoError(t, h.Erase("github.com"))
+	require.Equal(t, credentialHelperErase, gotVerb)
+	require.Equal(t, "github.com", gotStdin)
+}
+
+func TestCredentialHelper_List(t *testing.T) {
+	h := newCredentialHelper("pass")
+	h.exec = func(verb credentialHelperVerb, stdin []byte) ([]byte, error) {
+		require.Equal(t, credentialHelperList, verb)
+		return json.Marshal(map[string]string{"github.com": "monalisa"})
+	}
+
+	list, err := h.List()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"github.com": "monalisa"}, list)
+}
+
+func TestCredentialHelper_ListMalformedOutput(t *testing.T) {
+	h := newCredentialHelper("pass")
+	h.exec = func(verb credentialHelperVerb, stdin []byte) ([]byte, error) {
+		return []byte("not json"), nil
+	}
+
+	_, err := h.List()
+	require.Error(t, err)
+}
+
+func TestCredentialHelper_RejectsUnsafeName(t *testing.T) {
+	h := newCredentialHelper("../../tmp/evil")
+
+	_, err := h.run(credentialHelperGet, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,210 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cli/cli/v2/internal/keyring"
+	"github.com/cli/go-gh/v2/pkg/config"
+)
+
+// journalHostsEntry records a single leaf value from the hosts config
+// subtree, keyed by its path as a sequence of segments rather than a
+// joined string, since hostnames (e.g. "github.com") routinely contain
+// whatever separator a joined string would use.
+type journalHostsEntry struct {
+	Path  []string `json:"path"`
+	Value string   `json:"value"`
+}
+
+// journalKeyringEntry records whatever was in the keyring for a hostname
+// and account before a migration ran, so it can be put back if the
+// migration fails partway through.
+type journalKeyringEntry struct {
+	Hostname string `json:"hostname"`
+	Username string `json:"username"`
+	Value    string `json:"value"`
+	Found    bool   `json:"found"`
+}
+
+// journalData is the on-disk shape of a migration journal: everything
+// needed to restore both the hosts config subtree and the keyring to the
+// state they were in before the wrapped migration started.
+type journalData struct {
+	Hosts   []journalHostsEntry   `json:"hosts"`
+	Keyring []journalKeyringEntry `json:"keyring"`
+}
+
+// journaledMigration wraps a Migration with a snapshot/restore step so that
+// a failure partway through Do can't leave hosts.yml and the keyring in a
+// half-migrated state.
+type journaledMigration struct {
+	migration Migration
+}
+
+// Journaled wraps m so that its hosts config is snapshotted to a journal
+// file before Do runs, and, if m is keyringRecordable, each keyring entry
+// it reports is added to the journal just before it's overwritten. Both are
+// rolled back from that journal if Do returns an error. The journal is
+// removed on success, or after a rollback.
+func Journaled(m Migration) Migration {
+	return journaledMigration{migration: m}
+}
+
+func (j journaledMigration) PreVersion() string  { return j.migration.PreVersion() }
+func (j journaledMigration) PostVersion() string { return j.migration.PostVersion() }
+
+// keyringRecordable lets a migration report keyring writes to Journaled as
+// they happen, for migrations like MultiAccount whose destination username
+// isn't resolved until partway through Do, so the prior state of that exact
+// slot can still be captured before it's overwritten.
+type keyringRecordable interface {
+	withKeyringRecorder(record func(hostname, username string)) Migration
+}
+
+func (j journaledMigration) Do(c *config.Config) error {
+	hostsSnapshot, err := snapshotHosts(c)
+	if err != nil {
+		return fmt.Errorf("couldn't snapshot hosts configuration: %w", err)
+	}
+
+	path := journalPath(j.migration.PostVersion())
+
+	var keyringSnapshot []journalKeyringEntry
+	m := j.migration
+	if recordable, ok := m.(keyringRecordable); ok {
+		m = recordable.withKeyringRecorder(func(hostname, username string) {
+			value, err := keyring.Get(keyringServiceName(hostname), username)
+			keyringSnapshot = append(keyringSnapshot, journalKeyringEntry{
+				Hostname: hostname,
+				Username: username,
+				Value:    value,
+				Found:    err == nil,
+			})
+			// Rewrite the journal so a crash right after this keyring
+			// write is still recoverable, not just a failure returned
+			// from Do.
+			_ = writeJournal(path, journalData{Hosts: hostsSnapshot, Keyring: keyringSnapshot})
+		})
+	}
+
+	if err := writeJournal(path, journalData{Hosts: hostsSnapshot, Keyring: keyringSnapshot}); err != nil {
+		return fmt.Errorf("couldn't write migration journal: %w", err)
+	}
+
+	if doErr := m.Do(c); doErr != nil {
+		restoreHosts(c, hostsSnapshot)
+		restoreKeyring(keyringSnapshot)
+		_ = os.Remove(path)
+		return doErr
+	}
+
+	_ = os.Remove(path)
+	return nil
+}
+
+// Recover restores hosts config and keyring state from a journal left
+// behind by a process that crashed mid-migration, if one exists for
+// postVersion. It is a no-op if there's no journal on disk.
+func Recover(postVersion string, c *config.Config) error {
+	path := journalPath(postVersion)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read migration journal: %w", err)
+	}
+
+	var j journalData
+	if err := json.Unmarshal(data, &j); err != nil {
+		return fmt.Errorf("couldn't parse migration journal: %w", err)
+	}
+
+	restoreHosts(c, j.Hosts)
+	restoreKeyring(j.Keyring)
+
+	return os.Remove(path)
+}
+
+// restoreKeyring puts back whatever the recorder above captured, deleting any
+// entry that didn't previously exist.
+func restoreKeyring(snapshot []journalKeyringEntry) {
+	for _, entry := range snapshot {
+		if entry.Found {
+			_ = keyring.Set(keyringServiceName(entry.Hostname), entry.Username, entry.Value)
+		} else {
+			_ = keyring.Delete(keyringServiceName(entry.Hostname), entry.Username)
+		}
+	}
+}
+
+func journalPath(postVersion string) string {
+	return filepath.Join(config.ConfigDir(), "migrations", postVersion+".journal")
+}
+
+func writeJournal(path string, j journalData) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0771); err != nil {
+		return err
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// snapshotHosts flattens the entire hosts subtree into leaf entries keyed
+// by their path segments, so it can be replayed verbatim by restoreHosts
+// regardless of how deeply it's nested or what characters its keys
+// contain.
+func snapshotHosts(c *config.Config) ([]journalHostsEntry, error) {
+	var snapshot []journalHostsEntry
+	if err := walkKeys(c, hostsKey, &snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func walkKeys(c *config.Config, path []string, out *[]journalHostsEntry) error {
+	keys, err := c.Keys(path)
+	var keyNotFoundError *config.KeyNotFoundError
+	if errors.As(err, &keyNotFoundError) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		childPath := append(append([]string{}, path...), key)
+
+		children, err := c.Keys(childPath)
+		if err == nil && len(children) > 0 {
+			if err := walkKeys(c, childPath, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := c.Get(childPath)
+		if err != nil {
+			continue
+		}
+		*out = append(*out, journalHostsEntry{Path: childPath, Value: value})
+	}
+
+	return nil
+}
+
+// restoreHosts discards whatever is currently under hostsKey and replays
+// snapshot over it.
+func restoreHosts(c *config.Config, snapshot []journalHostsEntry) {
+	_ = c.Remove(hostsKey)
+	for _, entry := range snapshot {
+		c.Set(entry.Path, entry.Value)
+	}
+}
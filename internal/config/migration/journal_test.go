@@ -0,0 +1,183 @@
+package migration
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cli/cli/v2/internal/keyring"
+	"github.com/cli/go-gh/v2/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMigration struct {
+	post string
+	do   func(c *config.Config) error
+}
+
+func (f fakeMigration) PreVersion() string       { return "" }
+func (f fakeMigration) PostVersion() string      { return f.post }
+func (f fakeMigration) Do(c *config.Config) error { return f.do(c) }
+
+func TestJournaled_RollsBackHostsOnFailure(t *testing.T) {
+	c := config.NewFromString(`
+hosts:
+  github.com:
+    user: monalisa
+    git_protocol: https
+    oauth_token: abc123
+`)
+
+	failure := errors.New("boom")
+	m := Journaled(fakeMigration{
+		post: "99",
+		do: func(c *config.Config) error {
+			c.Set([]string{"hosts", "github.com", "user"}, "mutated")
+			_ = c.Remove([]string{"hosts", "github.com", "oauth_token"})
+			return failure
+		},
+	})
+
+	err := m.Do(c)
+	require.ErrorIs(t, err, failure)
+
+	user, err := c.Get([]string{"hosts", "github.com", "user"})
+	require.NoError(t, err)
+	require.Equal(t, "monalisa", user)
+
+	token, err := c.Get([]string{"hosts", "github.com", "oauth_token"})
+	require.NoError(t, err)
+	require.Equal(t, "abc123", token)
+}
+
+func TestJournaled_LeavesConfigAloneOnSuccess(t *testing.T) {
+	c := config.NewFromString(`
+hosts:
+  github.com:
+    user: monalisa
+`)
+
+	m := Journaled(fakeMigration{
+		post: "99",
+		do: func(c *config.Config) error {
+			c.Set([]string{"hosts", "github.com", "user"}, "mutated")
+			return nil
+		},
+	})
+
+	require.NoError(t, m.Do(c))
+
+	user, err := c.Get([]string{"hosts", "github.com", "user"})
+	require.NoError(t, err)
+	require.Equal(t, "mutated", user)
+}
+
+// TestSnapshotRestoreHosts_PreservesDottedHostnames guards against the
+// snapshot format joining path segments with a separator that can appear
+// in a hostname: "github.com" must round-trip as one segment, not be
+// fragmented into "github" and "com".
+func TestSnapshotRestoreHosts_PreservesDottedHostnames(t *testing.T) {
+	c := config.NewFromString(`
+hosts:
+  github.com:
+    user: monalisa
+    users:
+      monalisa:
+        oauth_token: abc123
+`)
+
+	snapshot, err := snapshotHosts(c)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Remove([]string{"hosts"}))
+
+	restoreHosts(c, snapshot)
+
+	token, err := c.Get([]string{"hosts", "github.com", "users", "monalisa", "oauth_token"})
+	require.NoError(t, err)
+	require.Equal(t, "abc123", token)
+
+	_, err = c.Get([]string{"hosts", "github", "com"})
+	require.Error(t, err)
+}
+
+// fakeRecordableMigration lets tests exercise the lazy keyring-recording
+// path that Journaled uses for migrations whose username isn't known
+// until partway through Do.
+type fakeRecordableMigration struct {
+	post     string
+	hostname string
+	username string
+	secret   string
+	err      error
+	record   func(hostname, username string)
+}
+
+func (f *fakeRecordableMigration) PreVersion() string  { return "" }
+func (f *fakeRecordableMigration) PostVersion() string { return f.post }
+
+func (f *fakeRecordableMigration) withKeyringRecorder(record func(hostname, username string)) Migration {
+	f.record = record
+	return f
+}
+
+func (f *fakeRecordableMigration) Do(c *config.Config) error {
+	if f.record != nil {
+		f.record(f.hostname, f.username)
+	}
+	if err := keyring.Set(keyringServiceName(f.hostname), f.username, f.secret); err != nil {
+		return err
+	}
+	return f.err
+}
+
+func TestJournaled_RollsBackLazilyRecordedKeyringWriteOnFailure(t *testing.T) {
+	keyring.MockInit()
+	require.NoError(t, keyring.Set(keyringServiceName("github.com"), "monalisa", "old-secret"))
+
+	c := config.NewFromString(`
+hosts:
+  github.com:
+    user: monalisa
+`)
+
+	failure := errors.New("boom")
+	m := Journaled(&fakeRecordableMigration{
+		post:     "99",
+		hostname: "github.com",
+		username: "monalisa",
+		secret:   "new-secret",
+		err:      failure,
+	})
+
+	err := m.Do(c)
+	require.ErrorIs(t, err, failure)
+
+	got, err := keyring.Get(keyringServiceName("github.com"), "monalisa")
+	require.NoError(t, err)
+	require.Equal(t, "old-secret", got)
+}
+
+func TestJournaled_DeletesPreviouslyAbsentKeyringEntryOnFailure(t *testing.T) {
+	keyring.MockInit()
+
+	c := config.NewFromString(`
+hosts:
+  github.com:
+    user: monalisa
+`)
+
+	failure := errors.New("boom")
+	m := Journaled(&fakeRecordableMigration{
+		post:     "99",
+		hostname: "github.com",
+		username: "monalisa",
+		secret:   "new-secret",
+		err:      failure,
+	})
+
+	err := m.Do(c)
+	require.ErrorIs(t, err, failure)
+
+	_, err = keyring.Get(keyringServiceName("github.com"), "monalisa")
+	require.ErrorIs(t, err, keyring.ErrNotFound)
+}
@@ -0,0 +1,17 @@
+package migration
+
+import "github.com/cli/go-gh/v2/pkg/config"
+
+// Migration is the interface that the gh config migration runner expects.
+// PreVersion/PostVersion let the runner figure out whether a migration
+// applies to the config it has in hand, and Do performs the migration.
+type Migration interface {
+	// PreVersion reports the config version this migration expects to run
+	// against.
+	PreVersion() string
+	// PostVersion reports the config version the config will be at once
+	// this migration has completed successfully.
+	PostVersion() string
+	// Do performs the migration, mutating c in place.
+	Do(c *config.Config) error
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/cli/cli/v2/internal/keyring"
 	ghAPI "github.com/cli/go-gh/v2/pkg/api"
@@ -69,6 +70,47 @@ type tokenSource struct {
 type MultiAccount struct {
 	// Allow injecting a transport layer in tests.
 	Transport http.RoundTripper
+
+	// Prompter, when set, is used to interactively ask the operator for a
+	// username or token we couldn't otherwise infer. Leave it nil for
+	// non-interactive callers, who keep the prior CowardlyRefusalError
+	// behavior.
+	Prompter Prompter
+	// StdinIsTTY gates the interactive fallback above; prompting when
+	// stdin isn't a terminal would just hang a non-interactive invocation.
+	StdinIsTTY bool
+	// AssumeUsers pre-seeds the login for a host, keyed by hostname, so
+	// scripted upgrades can answer via the --assume-user flag instead of
+	// a prompt.
+	AssumeUsers map[string]string
+
+	// recordKeyringWrite, when set by Journaled via withKeyringRecorder,
+	// is called immediately before migrateToken overwrites a keyring
+	// entry, so the prior value can be captured even though the username
+	// it's written under isn't known until Do resolves it.
+	recordKeyringWrite func(hostname, username string)
+}
+
+// withKeyringRecorder returns a copy of m that reports keyring writes to
+// record before they happen. It satisfies keyringRecordable for Journaled.
+func (m MultiAccount) withKeyringRecorder(record func(hostname, username string)) Migration {
+	m.recordKeyringWrite = record
+	return m
+}
+
+// NewMultiAccountMigration returns MultiAccount wrapped in Journaled, so
+// that a failure partway through (e.g. the keyring write for one host
+// failing after the config for an earlier host was already rewritten)
+// doesn't leave hosts.yml and the keyring in a half-migrated state.
+// Callers running the migration runner should use this instead of
+// constructing MultiAccount directly.
+func NewMultiAccountMigration(transport http.RoundTripper, prompter Prompter, stdinIsTTY bool, assumeUsers map[string]string) Migration {
+	return Journaled(MultiAccount{
+		Transport:   transport,
+		Prompter:    prompter,
+		StdinIsTTY:  stdinIsTTY,
+		AssumeUsers: assumeUsers,
+	})
 }
 
 func (m MultiAccount) PreVersion() string {
@@ -102,7 +144,7 @@ func (m MultiAccount) Do(c *config.Config) error {
 
 	// Otherwise let's get to the business of migrating!
 	for _, hostname := range hostnames {
-		tokenSource, err := getToken(c, hostname)
+		tokenSource, err := getToken(c, hostname, m.Prompter, m.StdinIsTTY)
 		// If no token existed for this host we'll remove the entry from the hosts file
 		// by deleting it and moving on to the next one.
 		if errors.Is(err, noTokenError) {
@@ -116,7 +158,12 @@ func (m MultiAccount) Do(c *config.Config) error {
 			return CowardlyRefusalError{fmt.Errorf("couldn't find oauth token for %q: %w", hostname, err)}
 		}
 
-		username, err := getUsername(c, hostname, tokenSource.token, m.Transport)
+		grantedScopes, err := checkTokenScopes(m.Transport, hostname, tokenSource.token)
+		if err != nil {
+			return CowardlyRefusalError{fmt.Errorf("couldn't verify oauth token for %q: %w", hostname, err)}
+		}
+
+		username, err := getUsername(c, hostname, tokenSource.token, m.Transport, m.AssumeUsers[hostname], m.Prompter, m.StdinIsTTY)
 		if err != nil {
 			return CowardlyRefusalError{fmt.Errorf("couldn't get user name for %q: %w", hostname, err)}
 		}
@@ -125,7 +172,7 @@ func (m MultiAccount) Do(c *config.Config) error {
 			return CowardlyRefusalError{fmt.Errorf("couldn't migrate config for %q: %w", hostname, err)}
 		}
 
-		if err := migrateToken(hostname, username, tokenSource); err != nil {
+		if err := migrateToken(c, hostname, username, tokenSource, grantedScopes, m.recordKeyringWrite); err != nil {
 			return CowardlyRefusalError{fmt.Errorf("couldn't migrate oauth token for %q: %w", hostname, err)}
 		}
 	}
@@ -133,34 +180,88 @@ func (m MultiAccount) Do(c *config.Config) error {
 	return nil
 }
 
-func getToken(c *config.Config, hostname string) (tokenSource, error) {
+func getToken(c *config.Config, hostname string, prompter Prompter, stdinIsTTY bool) (tokenSource, error) {
 	if token, _ := c.Get(append(hostsKey, hostname, "oauth_token")); token != "" {
 		return tokenSource{token: token, inKeyring: false}, nil
 	}
-	token, err := keyring.Get(keyringServiceName(hostname), "")
 
-	// If we have an error and it's not relating to there being no token
-	// then we'll return the error cause that's really unexpected.
-	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
-		return tokenSource{}, err
+	// A configured credential helper takes priority over the OS keyring,
+	// since it's how the operator told us they want secrets centralized.
+	if name := credentialHelperName(c, hostname); name != "" {
+		_, token, err := newCredentialHelper(name).Get(hostname)
+		// A transient helper failure (not installed, crashed, malformed
+		// output) is not the same as "no token exists"; surface it instead
+		// of silently falling through to deleting the host's config.
+		if err != nil {
+			return tokenSource{}, err
+		}
+		if token != "" {
+			return tokenSource{token: token, inKeyring: true}, nil
+		}
+	} else {
+		token, err := keyring.Get(keyringServiceName(hostname), "")
+
+		// If we have an error and it's not relating to there being no token
+		// then we'll return the error cause that's really unexpected.
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return tokenSource{}, err
+		}
+		if err == nil && token != "" {
+			return tokenSource{token: token, inKeyring: true}, nil
+		}
 	}
 
-	// Otherwise we'll return a sentinel error
-	if err != nil || token == "" {
-		return tokenSource{}, noTokenError
+	// We found no usable token anywhere. If the operator explicitly left
+	// oauth_token blank and we're attached to a terminal, ask them for one
+	// rather than giving up outright.
+	if stdinIsTTY && prompter != nil && hasOauthTokenEntry(c, hostname) {
+		token, err := promptForToken(prompter, hostname)
+		if err != nil {
+			return tokenSource{}, err
+		}
+		// Fill in the blank entry so migrateConfig carries the token over
+		// to the user's entry like any other token stored in the config.
+		c.Set(append(hostsKey, hostname, "oauth_token"), token)
+		return tokenSource{token: token, inKeyring: false}, nil
 	}
 
-	return tokenSource{
-		token:     token,
-		inKeyring: true,
-	}, nil
+	return tokenSource{}, noTokenError
 }
 
-func getUsername(c *config.Config, hostname, token string, transport http.RoundTripper) (string, error) {
+// hasOauthTokenEntry reports whether hostname has an oauth_token key at
+// all, even if its value is empty, to distinguish "no token configured"
+// from "token explicitly left blank for the operator to fill in".
+func hasOauthTokenEntry(c *config.Config, hostname string) bool {
+	keys, err := c.Keys(append(hostsKey, hostname))
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if key == "oauth_token" {
+			return true
+		}
+	}
+	return false
+}
+
+// credentialHelperName returns the name of the credential helper configured
+// for hostname via a `credential_helper: <name>` entry in hosts.yml, or ""
+// if the host should keep using the OS keyring.
+func credentialHelperName(c *config.Config, hostname string) string {
+	name, _ := c.Get(append(hostsKey, hostname, credentialHelperKey))
+	return name
+}
+
+func getUsername(c *config.Config, hostname, token string, transport http.RoundTripper, assumedUser string, prompter Prompter, stdinIsTTY bool) (string, error) {
 	username, _ := c.Get(append(hostsKey, hostname, "user"))
 	if username != "" && username != "x-access-token" {
 		return username, nil
 	}
+
+	if assumedUser != "" {
+		return assumedUser, nil
+	}
+
 	opts := ghAPI.ClientOptions{
 		Host:      hostname,
 		AuthToken: token,
@@ -177,19 +278,45 @@ func getUsername(c *config.Config, hostname, token string, transport http.RoundT
 	}
 	err = client.Query("CurrentUser", &query, nil)
 	if err != nil {
+		// Offline or network-restricted enterprise hosts can't always
+		// resolve a login this way; fall back to asking the operator if
+		// we're attached to a terminal.
+		if stdinIsTTY && prompter != nil {
+			return promptForUsername(prompter, hostname)
+		}
 		return "", err
 	}
 	return query.Viewer.Login, nil
 }
 
-func migrateToken(hostname, username string, tokenSource tokenSource) error {
+func migrateToken(c *config.Config, hostname, username string, tokenSource tokenSource, scopes []string, recordKeyringWrite func(hostname, username string)) error {
 	// If token is not currently stored in the keyring do not migrate it,
 	// as it is being stored in the config and is being handled when
 	// when migrating the config.
 	if !tokenSource.inKeyring {
 		return nil
 	}
-	return keyring.Set(keyringServiceName(hostname), username, tokenSource.token)
+
+	if name := credentialHelperName(c, hostname); name != "" {
+		return newCredentialHelper(name).Store(hostname, username, tokenSource.token)
+	}
+
+	// Give the journal a chance to capture whatever's currently at this
+	// keyring slot before we overwrite it.
+	if recordKeyringWrite != nil {
+		recordKeyringWrite(hostname, username)
+	}
+
+	cred := TokenCredential{
+		CredentialMeta: CredentialMeta{
+			CreatedAt: time.Now(),
+			Host:      hostname,
+			Login:     username,
+			Scopes:    scopes,
+		},
+		Token: tokenSource.token,
+	}
+	return CredentialStore{}.Store(hostname, username, cred)
 }
 
 func migrateConfig(c *config.Config, hostname, username string) error {
@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Prompter is satisfied by the gh CLI's interactive prompter. It's kept
+// narrow here so this package doesn't need to depend on the terminal
+// library directly, and so tests can supply a fake.
+type Prompter interface {
+	Input(prompt, defaultValue string) (string, error)
+}
+
+// usernameRegexp matches the shape of a GitHub login: alphanumeric, with
+// hyphens allowed only singly between alphanumerics (not leading, trailing
+// or consecutive). Go's regexp has no lookahead, so the 39 character limit
+// is checked separately by promptForUsername.
+var usernameRegexp = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9]|-[a-zA-Z0-9]){0,38}$`)
+
+// tokenRegexp matches a classic gho_/ghp_/ghu_/ghs_/ghr_ token, a
+// fine-grained github_pat_ token, or a classic 40 character hex PAT.
+var tokenRegexp = regexp.MustCompile(`^(gh[pousr]_[A-Za-z0-9_]{36,}|github_pat_[A-Za-z0-9_]{36,}|[a-f0-9]{40})$`)
+
+// promptForUsername asks the operator for the GitHub login associated with
+// a token we couldn't infer one for, re-prompting until the answer looks
+// like a valid GitHub username.
+func promptForUsername(prompter Prompter, hostname string) (string, error) {
+	for {
+		answer, err := prompter.Input(fmt.Sprintf("We couldn't determine the login for the %q token. What username should it be migrated as?", hostname), "")
+		if err != nil {
+			return "", err
+		}
+		if len(answer) <= 39 && usernameRegexp.MatchString(answer) {
+			return answer, nil
+		}
+		fmt.Println("That doesn't look like a valid GitHub username, please try again.")
+	}
+}
+
+// promptForToken asks the operator for a token to migrate when the config
+// has an empty oauth_token entry for hostname, re-prompting until the
+// answer looks like a gh token or classic PAT.
+func promptForToken(prompter Prompter, hostname string) (string, error) {
+	for {
+		answer, err := prompter.Input(fmt.Sprintf("We found no usable token for %q. Please paste a token to migrate:", hostname), "")
+		if err != nil {
+			return "", err
+		}
+		if tokenRegexp.MatchString(answer) {
+			return answer, nil
+		}
+		fmt.Println("That doesn't look like a valid GitHub token, please try again.")
+	}
+}
+
+// ParseAssumeUserFlag parses repeated --assume-user=host=login values into
+// the map MultiAccount.AssumeUsers expects, so that scripted upgrades can
+// pre-seed answers instead of being prompted.
+func ParseAssumeUserFlag(values []string) (map[string]string, error) {
+	assumeUsers := map[string]string{}
+	for _, value := range values {
+		host, login, ok := strings.Cut(value, "=")
+		if !ok || host == "" || login == "" {
+			return nil, fmt.Errorf("invalid --assume-user value %q, expected host=login", value)
+		}
+		assumeUsers[host] = login
+	}
+	return assumeUsers, nil
+}
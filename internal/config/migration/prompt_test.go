@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUsernameRegexp(t *testing.T) {
+	valid := []string{"monalisa", "a", "a-b", "a-b-c", "A1", "123"}
+	invalid := []string{"", "-abc", "abc-", "ab--cd", strings.Repeat("x", 40)}
+
+	for _, v := range valid {
+		if !usernameRegexp.MatchString(v) {
+			t.Errorf("expected %q to be a valid username", v)
+		}
+	}
+	for _, v := range invalid {
+		if usernameRegexp.MatchString(v) {
+			t.Errorf("expected %q to be an invalid username", v)
+		}
+	}
+}
+
+func TestTokenRegexp(t *testing.T) {
+	valid := []string{
+		"ghp_" + strings.Repeat("a", 36),
+		"gho_" + strings.Repeat("b", 40),
+		"github_pat_" + strings.Repeat("c", 36),
+		strings.Repeat("f", 40),
+	}
+	invalid := []string{
+		"",
+		"not-a-token",
+		"ghp_short",
+		strings.Repeat("g", 40), // not valid hex, and no recognized prefix
+	}
+
+	for _, v := range valid {
+		if !tokenRegexp.MatchString(v) {
+			t.Errorf("expected %q to be a valid token", v)
+		}
+	}
+	for _, v := range invalid {
+		if tokenRegexp.MatchString(v) {
+			t.Errorf("expected %q to be an invalid token", v)
+		}
+	}
+}
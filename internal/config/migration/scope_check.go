@@ -0,0 +1,119 @@
+package migration
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// requiredScopes are the OAuth scopes MultiAccount expects a token to carry
+// before it's safe to promote into the new per-user layout. Missing any of
+// these almost always means the token predates scopes gh now depends on.
+var requiredScopes = []string{"repo", "read:org", "gist"}
+
+// skipTokenCheckEnv lets offline or test environments opt out of the
+// network round trip checkTokenScopes makes.
+const skipTokenCheckEnv = "GH_MIGRATION_SKIP_TOKEN_CHECK"
+
+// InsufficientScopesError means a token is live but missing one or more of
+// requiredScopes.
+type InsufficientScopesError struct {
+	Hostname string
+	Missing  []string
+}
+
+func (e InsufficientScopesError) Error() string {
+	return fmt.Sprintf(
+		"token for %q is missing required scopes: %s (run `gh auth refresh -h %s -s %s`)",
+		e.Hostname, strings.Join(e.Missing, ", "), e.Hostname, strings.Join(e.Missing, ","),
+	)
+}
+
+// RevokedTokenError means a token was rejected outright by the host.
+type RevokedTokenError struct {
+	Hostname string
+}
+
+func (e RevokedTokenError) Error() string {
+	return fmt.Sprintf("token for %q has been revoked or is otherwise no longer valid", e.Hostname)
+}
+
+// checkTokenScopes verifies that token is both live and carries every scope
+// in requiredScopes, by issuing an authenticated request against hostname
+// and inspecting the X-OAuth-Scopes response header, the same signal go-gh's
+// IsAuthenticated relies on. It returns the scopes the host told us the
+// token carries, for callers that want to persist that alongside the
+// credential. It is skipped entirely when skipTokenCheckEnv is set, for
+// offline or test environments.
+func checkTokenScopes(transport http.RoundTripper, hostname, token string) ([]string, error) {
+	if os.Getenv(skipTokenCheckEnv) != "" {
+		return nil, nil
+	}
+
+	client := &http.Client{Transport: transport}
+	req, err := http.NewRequest(http.MethodGet, apiBaseURL(hostname)+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", token))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, RevokedTokenError{Hostname: hostname}
+	}
+
+	// Anything other than a successful response is unexpected (SSO
+	// enforcement, an IP allowlist, a secondary rate limit, a flaky GHES
+	// instance returning a 5xx, ...) and must not be read the same way as
+	// a 2xx with no scopes header, or we'd silently treat an unverifiable
+	// token as fine.
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status checking token scopes for %q: %s", hostname, resp.Status)
+	}
+
+	// Fine-grained PATs and GitHub App tokens don't carry classic OAuth
+	// scopes and never send this header at all, as opposed to a classic
+	// token sending it empty. We can't evaluate scopes we were never told
+	// about, so let those through rather than reporting every scope
+	// missing.
+	if _, ok := resp.Header["X-Oauth-Scopes"]; !ok {
+		return nil, nil
+	}
+
+	var granted []string
+	grantedSet := map[string]bool{}
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" && !grantedSet[scope] {
+			grantedSet[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+
+	var missing []string
+	for _, required := range requiredScopes {
+		if !grantedSet[required] {
+			missing = append(missing, required)
+		}
+	}
+	if len(missing) > 0 {
+		return granted, InsufficientScopesError{Hostname: hostname, Missing: missing}
+	}
+
+	return granted, nil
+}
+
+// apiBaseURL returns the REST API root for hostname, accounting for
+// GitHub.com living under a dedicated api subdomain while GitHub Enterprise
+// Server hosts serve their API under /api/v3.
+func apiBaseURL(hostname string) string {
+	if hostname == "github.com" {
+		return "https://api.github.com"
+	}
+	return fmt.Sprintf("https://%s/api/v3", hostname)
+}
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func fakeScopesResponse(status int, header http.Header) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+}
+
+func TestCheckTokenScopes_GrantedScopesOK(t *testing.T) {
+	transport := fakeScopesResponse(http.StatusOK, http.Header{
+		"X-Oauth-Scopes": []string{"repo, read:org, gist"},
+	})
+
+	scopes, err := checkTokenScopes(transport, "github.com", "abc123")
+	require.NoError(t, err)
+	require.Equal(t, []string{"repo", "read:org", "gist"}, scopes)
+}
+
+func TestCheckTokenScopes_MissingRequiredScope(t *testing.T) {
+	transport := fakeScopesResponse(http.StatusOK, http.Header{
+		"X-Oauth-Scopes": []string{"repo"},
+	})
+
+	scopes, err := checkTokenScopes(transport, "github.com", "abc123")
+	require.Error(t, err)
+	var insufficient InsufficientScopesError
+	require.ErrorAs(t, err, &insufficient)
+	require.Equal(t, []string{"repo"}, scopes)
+}
+
+func TestCheckTokenScopes_RevokedToken(t *testing.T) {
+	transport := fakeScopesResponse(http.StatusUnauthorized, http.Header{})
+
+	_, err := checkTokenScopes(transport, "github.com", "abc123")
+	var revoked RevokedTokenError
+	require.ErrorAs(t, err, &revoked)
+}
+
+func TestCheckTokenScopes_NoHeaderPassesThrough(t *testing.T) {
+	transport := fakeScopesResponse(http.StatusOK, http.Header{})
+
+	scopes, err := checkTokenScopes(transport, "github.com", "abc123")
+	require.NoError(t, err)
+	require.Nil(t, scopes)
+}
+
+func TestCheckTokenScopes_NonSuccessStatusIsError(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusInternalServerError, http.StatusBadGateway} {
+		transport := fakeScopesResponse(status, http.Header{})
+
+		_, err := checkTokenScopes(transport, "github.com", "abc123")
+		require.Errorf(t, err, "expected an error for status %d", status)
+	}
+}
+
+func TestCheckTokenScopes_SkippedViaEnv(t *testing.T) {
+	t.Setenv(skipTokenCheckEnv, "1")
+
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatal("checkTokenScopes should not make a request when skipTokenCheckEnv is set")
+		return nil, nil
+	})
+
+	scopes, err := checkTokenScopes(transport, "github.com", "abc123")
+	require.NoError(t, err)
+	require.Nil(t, scopes)
+}